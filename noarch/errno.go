@@ -0,0 +1,21 @@
+// Package noarch contains Go implementations of C standard library functions
+// that are not specific to any platform (darwin, linux, ...).
+package noarch
+
+// Errno wraps an underlying syscall or os error so that functions which are
+// transpiled from C library calls that set "errno" on failure (such as
+// strtol() or fopen()) can return it as an idiomatic Go error, the same way
+// cgo lets you write "n, err := C.strtol(...)".
+type Errno struct {
+	Err error
+}
+
+func (e *Errno) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap allows Errno to participate in errors.Is/errors.As against the
+// underlying syscall or os error.
+func (e *Errno) Unwrap() error {
+	return e.Err
+}
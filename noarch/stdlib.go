@@ -0,0 +1,18 @@
+package noarch
+
+import "strconv"
+
+// Strtol mirrors the C strtol() function. endptr, the "end of number" output
+// parameter, is accepted to match the C signature's arity but is otherwise
+// unused, since Go's strconv.ParseInt already reports an unparseable string
+// as an error rather than a partial conversion. On failure it returns an
+// *Errno wrapping the underlying parse error, mirroring how "errno" would be
+// set to EINVAL in C.
+func Strtol(s string, endptr *string, base int) (int64, error) {
+	n, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, &Errno{Err: err}
+	}
+
+	return n, nil
+}
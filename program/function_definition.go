@@ -1,6 +1,7 @@
 package program
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 )
@@ -13,20 +14,153 @@ type FunctionDefinition struct {
 	// The C return type, like "int".
 	ReturnType string
 
-	// The C argument types, like ["bool", "int"]. There is currently no way
-	// to represent a varargs.
+	// The C argument types, like ["bool", "int"].
 	ArgumentTypes []string
 
+	// IsVariadic is true when the function prototype ends in a "..." (such
+	// as printf()). Arguments beyond len(ArgumentTypes) are passed through
+	// without a cast, and getFieldList() will emit a trailing
+	// "...interface{}" parameter for the Go function signature.
+	IsVariadic bool
+
 	// If this is not empty then this function name should be used instead
 	// of the Name. Many low level functions have an exact match with a Go
 	// function. For example, "sin()".
 	Substitution string
+
+	// SetsErrno is true for C library functions that communicate failure
+	// through the global "errno" rather than (only) their return value, such
+	// as "strtol" or "fopen". When this is true the Substitution is expected
+	// to have a Go signature of "(T, error)" so that callers can recover the
+	// underlying errno as an idiomatic Go error instead of inspecting a
+	// global.
+	SetsErrno bool
+
+	// Header, if not empty, restricts this definition to translation units
+	// that included the named header (e.g. "stdio.h"). This lets
+	// user-supplied substitutions (see RegisterSubstitutionFile) target a
+	// specific standard function without accidentally shadowing a
+	// user-defined function of the same name that isn't declared by that
+	// header.
+	Header string
+
+	// MinStdC, if not empty, restricts this definition to translation units
+	// compiled against at least the named C standard (e.g. "C99").
+	MinStdC string
+
+	// OutputParamIndices lists the positions (within ArgumentTypes) of
+	// parameters that were pointer "output" parameters in the original C
+	// signature - e.g. the second argument of "int parse(const char*, int*)"
+	// - but have been rewritten to an additional Go return value instead.
+	// OutputParamNames holds the corresponding C parameter name for each
+	// entry, in the same order, so that the function body can refer back to
+	// it when synthesizing the return statement.
+	OutputParamIndices []int
+	OutputParamNames   []string
 }
 
 var functionDefinitions map[string]FunctionDefinition
 
 var builtInFunctionDefinitionsHaveBeenLoaded = false
 
+// includedHeaders tracks, for the translation unit currently being
+// transpiled, which C headers have been #include'd. It is consulted by
+// GetFunctionDefinition via MatchesIncludedHeaders so that a substitution
+// restricted to a specific Header (see FunctionDefinition.Header) is only
+// used once that header has actually been seen, rather than shadowing a
+// user-defined function of the same name in a file that never included it.
+var includedHeaders = map[string]bool{}
+
+// IncludeHeader records that the current translation unit includes header
+// (for example "stdio.h"). ScanIncludedHeaders calls it for every #include
+// directive found in the source text; it must run before the functions the
+// header defines are looked up.
+func IncludeHeader(header string) {
+	includedHeaders[header] = true
+}
+
+// ResetIncludedHeaders clears the set of headers recorded by IncludeHeader.
+// It should be called before starting a new translation unit, so that one
+// file's #include directives can't leak into the next.
+func ResetIncludedHeaders() {
+	includedHeaders = map[string]bool{}
+}
+
+// includeDirectiveRegexp matches a C preprocessor #include directive,
+// capturing the header name out of either the <...> or "..." form.
+var includeDirectiveRegexp = regexp.MustCompile(`^\s*#\s*include\s*[<"]([^>"]+)[>"]`)
+
+// ScanIncludedHeaders records, via IncludeHeader, every header #include'd by
+// source - the literal C source text of the translation unit currently
+// being transpiled. The ast package's nodes come from clang's parser, not
+// its preprocessor, so there is no #include node to walk; scanning the
+// source text directly is the only way to recover this without a real C
+// preprocessor. It should be called once per translation unit, right after
+// ResetIncludedHeaders and before any function in it is transpiled.
+func ScanIncludedHeaders(source string) {
+	for _, line := range strings.Split(source, "\n") {
+		if match := includeDirectiveRegexp.FindStringSubmatch(line); match != nil {
+			IncludeHeader(match[1])
+		}
+	}
+}
+
+// currentStdC is the C standard (for example "C99") the translation unit
+// currently being transpiled targets, as recorded by SetStdC. An empty
+// value (the default) means no standard has been recorded, in which case
+// MatchesMinStdC treats every definition as eligible.
+var currentStdC = ""
+
+// SetStdC records the C standard the current translation unit is compiled
+// against, so that GetFunctionDefinition can exclude a definition whose
+// MinStdC requires a later standard than this translation unit targets.
+// Mirroring IncludeHeader/ResetIncludedHeaders, it should be called once per
+// translation unit, before any function definition is looked up.
+func SetStdC(std string) {
+	currentStdC = std
+}
+
+// ResetStdC clears the C standard recorded by SetStdC, so that one
+// translation unit's standard can't leak into the next.
+func ResetStdC() {
+	currentStdC = ""
+}
+
+// stdCRank orders recognized C standard names from oldest to newest, so
+// MatchesMinStdC can compare two of them numerically instead of lexically
+// (where, for example, "C11" < "C9" as strings but should compare as
+// greater).
+var stdCRank = map[string]int{
+	"C89": 1, "C90": 1, "ANSI": 1,
+	"C99": 2,
+	"C11": 3,
+	"C17": 4, "C18": 4,
+	"C23": 5,
+}
+
+// MatchesMinStdC reports whether def is eligible for a translation unit
+// compiled against std (as recorded by SetStdC). A definition with no
+// MinStdC always matches; an std or MinStdC this module doesn't recognize
+// is also treated as matching, since there is no authoritative list of
+// every standard name a real compiler might report.
+func MatchesMinStdC(def *FunctionDefinition, std string) bool {
+	if def.MinStdC == "" {
+		return true
+	}
+
+	want, ok := stdCRank[strings.ToUpper(def.MinStdC)]
+	if !ok {
+		return true
+	}
+
+	got, ok := stdCRank[strings.ToUpper(std)]
+	if !ok {
+		return true
+	}
+
+	return got >= want
+}
+
 // Each of the predefined function have a syntax that allows them to be easy to
 // read (and maintain). For example:
 //
@@ -39,6 +173,20 @@ var builtInFunctionDefinitionsHaveBeenLoaded = false
 //     github.com/elliotchance/c2go/darwin.Fabs
 //
 // THe substitution is optional.
+//
+// Functions that set the C "errno" on failure can be marked with a trailing
+// "!errno" token, like:
+//
+//     long strtol(const char*, char**, int) !errno -> noarch.Strtol
+//
+// This tells the transpiler that the substitution returns "(T, error)"
+// instead of a plain "T", so that call sites can surface the error in Go's
+// idiomatic two-value form.
+//
+// A trailing "..." in the argument list marks the function as variadic,
+// like:
+//
+//     int printf(const char*, ...) -> fmt.Printf
 var builtInFunctionDefinitions = []string{
 	// darwin/assert.h
 	"int __builtin_expect(int, int) -> darwin.BuiltinExpect",
@@ -94,32 +242,36 @@ var builtInFunctionDefinitions = []string{
 	"double tanh(double) -> math.Tanh",
 
 	// stdio.h
-	"int printf() -> fmt.Printf",
-	"int scanf() -> fmt.Scanf",
+	"int printf(const char*, ...) -> fmt.Printf",
+	"int scanf(const char*, ...) -> fmt.Scanf",
 	"int putchar(int) -> darwin.Putchar",
 	"int puts(const char *) -> fmt.Println",
-	"FILE* fopen(const char *, const char *) -> noarch.Fopen",
+	"FILE* fopen(const char *, const char *) !errno -> noarch.Fopen",
 	"int fclose(int) -> noarch.Fclose",
 
 	// stdlib.h
 	"int atoi(const char*) -> noarch.Atoi",
-	"long strtol(const char *, char **, int) -> noarch.Strtol",
+	"long strtol(const char *, char **, int) !errno -> noarch.Strtol",
 
 	// I'm not sure which header file these comes from?
 	"uint32 __builtin_bswap32(uint32) -> darwin.BSwap32",
 	"uint64 __builtin_bswap64(uint64) -> darwin.BSwap64",
 }
 
-// getFunctionDefinition will return nil if the function does not exist (is not
-// registered).
+// getFunctionDefinition will return nil if the function does not exist (is
+// not registered), if it is restricted to a header (see
+// FunctionDefinition.Header) that IncludeHeader has not recorded for the
+// current translation unit, or if it requires a later C standard (see
+// FunctionDefinition.MinStdC) than SetStdC has recorded.
 func GetFunctionDefinition(functionName string) *FunctionDefinition {
 	loadFunctionDefinitions()
 
-	if f, ok := functionDefinitions[functionName]; ok {
-		return &f
+	f, ok := functionDefinitions[functionName]
+	if !ok || !MatchesIncludedHeaders(&f, includedHeaders) || !MatchesMinStdC(&f, currentStdC) {
+		return nil
 	}
 
-	return nil
+	return &f
 }
 
 // addFunctionDefinition registers a function definition. If the definition
@@ -130,6 +282,30 @@ func AddFunctionDefinition(f FunctionDefinition) {
 	functionDefinitions[f.Name] = f
 }
 
+// SubstitutionFunctions returns every registered FunctionDefinition whose Go
+// substitution resolves into the module-local package pkgName (for example
+// "noarch"), keyed by the unqualified Go function name ("Strtol" for
+// "noarch.Strtol"). This lets a consumer that doesn't have access to
+// noarch/darwin/linux's real source (such as transpiler.Verify's synthetic
+// type-checking shim) reconstruct the signatures it needs to resolve calls
+// into them from the same data this package already uses to emit those
+// calls in the first place.
+func SubstitutionFunctions(pkgName string) map[string]FunctionDefinition {
+	loadFunctionDefinitions()
+
+	prefix := "github.com/elliotchance/c2go/" + pkgName + "."
+	result := map[string]FunctionDefinition{}
+	for _, def := range functionDefinitions {
+		if !strings.HasPrefix(def.Substitution, prefix) {
+			continue
+		}
+
+		result[strings.TrimPrefix(def.Substitution, prefix)] = def
+	}
+
+	return result
+}
+
 func loadFunctionDefinitions() {
 	if builtInFunctionDefinitionsHaveBeenLoaded {
 		return
@@ -139,34 +315,87 @@ func loadFunctionDefinitions() {
 	builtInFunctionDefinitionsHaveBeenLoaded = true
 
 	for _, f := range builtInFunctionDefinitions {
-		match := regexp.MustCompile(`^(.+) (.+)\((.*)\)( -> .*)?$`).
-			FindStringSubmatch(f)
-
-		// Unpack argument types.
-		argumentTypes := strings.Split(match[3], ",")
-		for i := range argumentTypes {
-			argumentTypes[i] = strings.TrimSpace(argumentTypes[i])
-		}
-		if len(argumentTypes) == 1 && argumentTypes[0] == "" {
-			argumentTypes = []string{}
+		def, err := parseFunctionDefinitionLine(f)
+		if err != nil {
+			// The built-in table is fixed at compile time, so a bad entry
+			// here is a programming error, not a user error.
+			panic(err)
 		}
 
-		// Substitution rules.
-		substitution := match[4]
-		if substitution != "" {
-			substitution = strings.TrimLeft(substitution, " ->")
-		}
-		if strings.HasPrefix(substitution, "darwin.") ||
-			strings.HasPrefix(substitution, "linux.") ||
-			strings.HasPrefix(substitution, "noarch.") {
-			substitution = "github.com/elliotchance/c2go/" + substitution
+		AddFunctionDefinition(def)
+	}
+
+	loadSubstitutionsFromEnv()
+}
+
+// parseFunctionDefinitionLine parses a single line of the grammar described
+// in the comment on builtInFunctionDefinitions, plus the optional
+// "@header:<name>" and "@min_stdc:<std>" annotations understood by
+// RegisterSubstitutionFile.
+func parseFunctionDefinitionLine(line string) (FunctionDefinition, error) {
+	// Annotations may appear anywhere (conventionally at the end) as
+	// whitespace-separated "@key:value" tokens. Pull them out first so the
+	// rest of the grammar doesn't need to know about them.
+	header, minStdC := "", ""
+	var coreFields []string
+	for _, field := range strings.Fields(line) {
+		switch {
+		case strings.HasPrefix(field, "@header:"):
+			header = strings.TrimPrefix(field, "@header:")
+		case strings.HasPrefix(field, "@min_stdc:"):
+			minStdC = strings.TrimPrefix(field, "@min_stdc:")
+		default:
+			coreFields = append(coreFields, field)
 		}
+	}
+
+	match := regexp.MustCompile(`^(.+) (.+)\((.*)\)( !errno)?( -> .*)?$`).
+		FindStringSubmatch(strings.Join(coreFields, " "))
+	if match == nil {
+		return FunctionDefinition{}, fmt.Errorf(
+			"invalid function definition: %q", line)
+	}
 
-		AddFunctionDefinition(FunctionDefinition{
-			Name:          match[2],
-			ReturnType:    match[1],
-			ArgumentTypes: argumentTypes,
-			Substitution:  substitution,
-		})
+	// Unpack argument types.
+	argumentTypes := strings.Split(match[3], ",")
+	for i := range argumentTypes {
+		argumentTypes[i] = strings.TrimSpace(argumentTypes[i])
+	}
+	if len(argumentTypes) == 1 && argumentTypes[0] == "" {
+		argumentTypes = []string{}
 	}
+
+	// A trailing "..." marks the function as variadic. It is not a real
+	// argument type so it's removed from the list.
+	isVariadic := false
+	if len(argumentTypes) > 0 && argumentTypes[len(argumentTypes)-1] == "..." {
+		isVariadic = true
+		argumentTypes = argumentTypes[:len(argumentTypes)-1]
+	}
+
+	// The "!errno" token is optional and marks a function as setting the
+	// C errno on failure.
+	setsErrno := match[4] != ""
+
+	// Substitution rules.
+	substitution := match[5]
+	if substitution != "" {
+		substitution = strings.TrimLeft(substitution, " ->")
+	}
+	if strings.HasPrefix(substitution, "darwin.") ||
+		strings.HasPrefix(substitution, "linux.") ||
+		strings.HasPrefix(substitution, "noarch.") {
+		substitution = "github.com/elliotchance/c2go/" + substitution
+	}
+
+	return FunctionDefinition{
+		Name:          match[2],
+		ReturnType:    match[1],
+		ArgumentTypes: argumentTypes,
+		Substitution:  substitution,
+		SetsErrno:     setsErrno,
+		IsVariadic:    isVariadic,
+		Header:        header,
+		MinStdC:       minStdC,
+	}, nil
 }
@@ -0,0 +1,134 @@
+package program
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFunctionDefinitionLine(t *testing.T) {
+	got, err := parseFunctionDefinitionLine(
+		"long strtol(const char *, char **, int) !errno @header:stdlib.h -> noarch.Strtol")
+	if err != nil {
+		t.Fatalf("parseFunctionDefinitionLine returned error: %v", err)
+	}
+
+	want := FunctionDefinition{
+		Name:          "strtol",
+		ReturnType:    "long",
+		ArgumentTypes: []string{"const char *", "char **", "int"},
+		Substitution:  "github.com/elliotchance/c2go/noarch.Strtol",
+		SetsErrno:     true,
+		Header:        "stdlib.h",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseFunctionDefinitionLine() = %#v, want %#v", got, want)
+	}
+}
+
+func TestMatchesIncludedHeaders(t *testing.T) {
+	unrestricted := &FunctionDefinition{Name: "atoi"}
+	restricted := &FunctionDefinition{Name: "my_log", Header: "my_log.h"}
+
+	included := map[string]bool{"my_log.h": true}
+	notIncluded := map[string]bool{}
+
+	if !MatchesIncludedHeaders(unrestricted, notIncluded) {
+		t.Error("a definition with no Header should always match")
+	}
+
+	if !MatchesIncludedHeaders(restricted, included) {
+		t.Error("expected restricted definition to match when its header is included")
+	}
+
+	if MatchesIncludedHeaders(restricted, notIncluded) {
+		t.Error("expected restricted definition not to match when its header is not included")
+	}
+}
+
+func TestGetFunctionDefinition_HeaderRestricted(t *testing.T) {
+	ResetIncludedHeaders()
+	defer ResetIncludedHeaders()
+
+	AddFunctionDefinition(FunctionDefinition{
+		Name:   "my_log",
+		Header: "my_log.h",
+	})
+
+	if def := GetFunctionDefinition("my_log"); def != nil {
+		t.Error("expected my_log to be unavailable before its header is included")
+	}
+
+	IncludeHeader("my_log.h")
+
+	if def := GetFunctionDefinition("my_log"); def == nil {
+		t.Error("expected my_log to be available once its header is included")
+	}
+}
+
+func TestScanIncludedHeaders(t *testing.T) {
+	ResetIncludedHeaders()
+	defer ResetIncludedHeaders()
+
+	ScanIncludedHeaders(`
+#include <stdio.h>
+# include "my_log.h"
+int main() { return 0; }
+`)
+
+	for _, header := range []string{"stdio.h", "my_log.h"} {
+		if !includedHeaders[header] {
+			t.Errorf("expected %q to be recorded as included", header)
+		}
+	}
+
+	if includedHeaders["stdlib.h"] {
+		t.Error("expected stdlib.h not to be recorded; it was never included")
+	}
+}
+
+func TestMatchesMinStdC(t *testing.T) {
+	unrestricted := &FunctionDefinition{Name: "atoi"}
+	restricted := &FunctionDefinition{Name: "my_func", MinStdC: "C99"}
+
+	tests := []struct {
+		def  *FunctionDefinition
+		std  string
+		want bool
+	}{
+		{unrestricted, "", true},
+		{unrestricted, "C89", true},
+		{restricted, "", true},     // unrecognized std: permissive
+		{restricted, "c89", false}, // matched case-insensitively, too old
+		{restricted, "C89", false}, // recognized std, but too old
+		{restricted, "C99", true},  // exactly the required standard
+		{restricted, "C11", true},  // newer than required
+	}
+
+	for _, test := range tests {
+		if got := MatchesMinStdC(test.def, test.std); got != test.want {
+			t.Errorf("MatchesMinStdC(%+v, %q) = %v, want %v",
+				test.def, test.std, got, test.want)
+		}
+	}
+}
+
+func TestGetFunctionDefinition_MinStdCRestricted(t *testing.T) {
+	ResetStdC()
+	defer ResetStdC()
+
+	AddFunctionDefinition(FunctionDefinition{
+		Name:    "my_func99",
+		MinStdC: "C99",
+	})
+
+	SetStdC("C89")
+	if def := GetFunctionDefinition("my_func99"); def != nil {
+		t.Error("expected my_func99 to be unavailable under C89")
+	}
+
+	SetStdC("C99")
+	if def := GetFunctionDefinition("my_func99"); def == nil {
+		t.Error("expected my_func99 to be available under C99")
+	}
+}
@@ -0,0 +1,261 @@
+package program
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// substitutionEnvVar is the environment variable that lists one or more
+// (colon-separated, matching $PATH conventions) user substitution files to
+// load in addition to the built-in table.
+const substitutionEnvVar = "C2GO_SUBST"
+
+// substFlag is the "-subst" command-line flag equivalent of
+// substitutionEnvVar: also a colon-separated list of substitution files,
+// registered into flag.CommandLine so any program that calls flag.Parse()
+// picks it up without this package needing to know about that program's
+// main(). Whatever main() imports this package transitively gets the flag
+// for free, the same way every package registering a flag at init time
+// does.
+var substFlag = flag.String("subst", "",
+	"colon-separated list of substitution files to load, in addition to "+
+		"those named by the "+substitutionEnvVar+" environment variable")
+
+// RegisterSubstitutionFile loads user-supplied function substitutions from
+// path and adds them to the registry, so that C symbols can be mapped to Go
+// replacements without editing this package.
+//
+// A path ending in ".yaml" or ".yml" is loaded as a list of structured
+// entries (see RegisterSubstitutionFileYAML for the format); any other path
+// is loaded one definition per line, using the same grammar as
+// builtInFunctionDefinitions, for example:
+//
+//     int my_log(const char*, ...) !errno @header:my_log.h -> mylib.Log
+//
+// A definition loaded this way will replace any built-in definition (or one
+// loaded from an earlier file) with the same name.
+func RegisterSubstitutionFile(path string) error {
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		return RegisterSubstitutionFileYAML(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("c2go: cannot read substitution file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	// Loading a user file implies the built-ins must already be in the
+	// registry so that later entries can override earlier ones.
+	loadFunctionDefinitions()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		def, err := parseFunctionDefinitionLine(line)
+		if err != nil {
+			return fmt.Errorf("c2go: %s: %w", path, err)
+		}
+
+		AddFunctionDefinition(def)
+	}
+
+	return scanner.Err()
+}
+
+// RegisterSubstitutionFileYAML loads user-supplied function substitutions
+// from path, a list of structured entries, and adds them to the registry.
+// This module is stdlib-only and has no vendored YAML library, so rather
+// than depend on one, this parses the
+// restricted subset of YAML needed to express one FunctionDefinition per
+// list entry: a top-level block sequence of flow-less mappings, like
+//
+//     - name: my_log
+//       return: int
+//       args: [const char*, ...]
+//       sets_errno: false
+//       header: my_log.h
+//       min_stdc: C99
+//       substitution: mylib.Log
+//
+// "args" is a flow sequence (square brackets); every other value is a bare
+// scalar. A trailing "..." entry in "args" marks the function variadic, the
+// same as the single-line grammar's trailing "...". All fields except
+// "name" and "return" are optional. Anything outside this subset (anchors,
+// multi-document streams, block scalars, nested mappings, ...) will not
+// parse correctly.
+func RegisterSubstitutionFileYAML(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("c2go: cannot read substitution file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	loadFunctionDefinitions()
+
+	var current map[string]string
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+
+		def, err := functionDefinitionFromYAMLEntry(current)
+		if err != nil {
+			return fmt.Errorf("c2go: %s: %w", path, err)
+		}
+
+		AddFunctionDefinition(def)
+		current = nil
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "- ") {
+			if err := flush(); err != nil {
+				return err
+			}
+
+			current = map[string]string{}
+			line = strings.TrimPrefix(line, "- ")
+		}
+
+		if current == nil {
+			return fmt.Errorf("c2go: %s: expected a list entry starting with \"- \", got %q", path, line)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("c2go: %s: expected \"key: value\", got %q", path, line)
+		}
+
+		current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// functionDefinitionFromYAMLEntry builds a FunctionDefinition from one
+// parsed YAML-subset entry's fields, as collected by
+// RegisterSubstitutionFileYAML.
+func functionDefinitionFromYAMLEntry(fields map[string]string) (FunctionDefinition, error) {
+	name, returnType := fields["name"], fields["return"]
+	if name == "" || returnType == "" {
+		return FunctionDefinition{}, fmt.Errorf(
+			"entry is missing required field \"name\" or \"return\": %v", fields)
+	}
+
+	argumentTypes, isVariadic := []string{}, false
+	if args := strings.TrimSpace(fields["args"]); args != "" {
+		args = strings.TrimSuffix(strings.TrimPrefix(args, "["), "]")
+		for _, arg := range strings.Split(args, ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				continue
+			}
+
+			if arg == "..." {
+				isVariadic = true
+				continue
+			}
+
+			argumentTypes = append(argumentTypes, arg)
+		}
+	}
+
+	setsErrno := false
+	if v := fields["sets_errno"]; v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return FunctionDefinition{}, fmt.Errorf("sets_errno: %w", err)
+		}
+		setsErrno = parsed
+	}
+
+	substitution := fields["substitution"]
+	if strings.HasPrefix(substitution, "darwin.") ||
+		strings.HasPrefix(substitution, "linux.") ||
+		strings.HasPrefix(substitution, "noarch.") {
+		substitution = "github.com/elliotchance/c2go/" + substitution
+	}
+
+	return FunctionDefinition{
+		Name:          name,
+		ReturnType:    returnType,
+		ArgumentTypes: argumentTypes,
+		IsVariadic:    isVariadic,
+		Substitution:  substitution,
+		SetsErrno:     setsErrno,
+		Header:        fields["header"],
+		MinStdC:       fields["min_stdc"],
+	}, nil
+}
+
+// loadSubstitutionsFromEnv loads any substitution files named by the
+// C2GO_SUBST environment variable and the "-subst" flag (see substFlag). It
+// is called once, automatically, right after the built-in definitions are
+// loaded.
+func loadSubstitutionsFromEnv() {
+	loadSubstitutionPaths(os.Getenv(substitutionEnvVar))
+
+	// flag.Parse() is main()'s responsibility, not this package's; if it
+	// hasn't been called yet (or this binary doesn't use the flag package
+	// at all), substFlag is simply still its zero value and this is a
+	// no-op.
+	loadSubstitutionPaths(*substFlag)
+}
+
+// loadSubstitutionPaths loads every non-empty, colon-separated path in
+// paths, warning to stderr (rather than failing the whole transpile) on any
+// file that can't be loaded.
+func loadSubstitutionPaths(paths string) {
+	if paths == "" {
+		return
+	}
+
+	for _, path := range strings.Split(paths, ":") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if err := RegisterSubstitutionFile(path); err != nil {
+			// Loading environment/flag-provided substitutions is
+			// best-effort: a missing or malformed file shouldn't stop the
+			// whole transpile.
+			fmt.Fprintf(os.Stderr, "c2go: warning: %s\n", err)
+		}
+	}
+}
+
+// MatchesIncludedHeaders reports whether def is eligible to be used for a
+// translation unit that included the given set of headers. A definition with
+// no Header restriction always matches; together with the headers recorded
+// by ScanIncludedHeaders this filters out user substitutions that target a
+// header the current file never pulled in, avoiding collisions with a
+// user-defined function of the same name.
+func MatchesIncludedHeaders(def *FunctionDefinition, includedHeaders map[string]bool) bool {
+	if def.Header == "" {
+		return true
+	}
+
+	return includedHeaders[def.Header]
+}
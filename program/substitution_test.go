@@ -0,0 +1,85 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegisterSubstitutionFileYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subst.yaml")
+	contents := `
+# a comment, and a blank line above should both be ignored
+- name: my_log
+  return: int
+  args: [const char*, ...]
+  sets_errno: false
+  header: my_log.h
+  min_stdc: C99
+  substitution: mylib.Log
+- name: my_strtol
+  return: long
+  args: [const char *, char **, int]
+  sets_errno: true
+  substitution: noarch.Strtol
+`
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterSubstitutionFileYAML(path); err != nil {
+		t.Fatalf("RegisterSubstitutionFileYAML() returned error: %v", err)
+	}
+
+	myLog, ok := functionDefinitions["my_log"]
+	if !ok {
+		t.Fatal("expected \"my_log\" to be registered")
+	}
+
+	wantMyLog := FunctionDefinition{
+		Name:          "my_log",
+		ReturnType:    "int",
+		ArgumentTypes: []string{"const char*"},
+		IsVariadic:    true,
+		Substitution:  "mylib.Log",
+		SetsErrno:     false,
+		Header:        "my_log.h",
+		MinStdC:       "C99",
+	}
+	if !reflect.DeepEqual(myLog, wantMyLog) {
+		t.Errorf("functionDefinitions[\"my_log\"] = %#v, want %#v", myLog, wantMyLog)
+	}
+
+	myStrtol, ok := functionDefinitions["my_strtol"]
+	if !ok {
+		t.Fatal("expected \"my_strtol\" to be registered")
+	}
+
+	wantMyStrtol := FunctionDefinition{
+		Name:          "my_strtol",
+		ReturnType:    "long",
+		ArgumentTypes: []string{"const char *", "char **", "int"},
+		Substitution:  "github.com/elliotchance/c2go/noarch.Strtol",
+		SetsErrno:     true,
+	}
+	if !reflect.DeepEqual(myStrtol, wantMyStrtol) {
+		t.Errorf("functionDefinitions[\"my_strtol\"] = %#v, want %#v", myStrtol, wantMyStrtol)
+	}
+}
+
+func TestRegisterSubstitutionFile_DispatchesOnExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subst.yaml")
+	contents := "- name: my_dispatch_check\n  return: void\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterSubstitutionFile(path); err != nil {
+		t.Fatalf("RegisterSubstitutionFile() returned error: %v", err)
+	}
+
+	if _, ok := functionDefinitions["my_dispatch_check"]; !ok {
+		t.Error("expected RegisterSubstitutionFile to dispatch a \".yaml\" path to the YAML-subset parser")
+	}
+}
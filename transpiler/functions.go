@@ -14,20 +14,138 @@ import (
 	"github.com/elliotchance/c2go/types"
 
 	goast "go/ast"
+	"go/token"
 )
 
-// transpileCallExpr transpiles expressions that calls a function, for example:
+// transpileCallExpr transpiles a function call expression for a single-value
+// context - a bare expression statement, a function argument, anywhere only
+// one Go value can be used - for example:
 //
 //     foo("bar")
 //
-// It returns three arguments; the Go AST expression, the C type (that is
-// returned by the function) and any error. If there is an error returned you
-// can assume the first two arguments will not contain any useful information.
+// It is a convenience wrapper around transpileCallExprForTargets for exactly
+// this case; see that function for how multi-valued substitutions (errno,
+// rewritten output parameters) are handled.
 func transpileCallExpr(n *ast.CallExpr, p *program.Program) (*goast.CallExpr, string, error) {
-	// The first child will always contain the name of the function being
-	// called.
-	firstChild := n.Children[0].(*ast.ImplicitCastExpr).Children[0]
-	functionName := firstChild.(*ast.DeclRefExpr).Name
+	return transpileCallExprForTargets(n, p, 1)
+}
+
+// transpileCallExprForTargets transpiles a function call expression that
+// will be assigned into numTargets Go values, such as the 2 in
+// "n, err := strtol(...)". It returns three arguments; the Go AST expression,
+// the C type returned by the function, and any error. If there is an error
+// returned you can assume the first two arguments will not contain any
+// useful information.
+//
+// Some C library functions (such as "strtol" or "fopen") communicate failure
+// through "errno" rather than their return value. Those are marked with
+// FunctionDefinition.SetsErrno and their Go substitution returns "(T, error)"
+// instead of a plain "T". Likewise, a function with
+// FunctionDefinition.OutputParamIndices (see detectOutputParams) has had its
+// pointer "output" parameters dropped from the call entirely; they are
+// returned as additional values instead. When numTargets is large enough to
+// receive every value the call actually produces, the real, possibly
+// multi-valued call is returned as-is - this is what lets a caller with a
+// two-target assignment produce "n, err := noarch.Strtol(...)" directly.
+// Otherwise (numTargets is smaller, most commonly the implicit 1 of a
+// single-value context) the call is wrapped in an immediately invoked
+// function literal (wrapSingleValue) that assigns the extra values where
+// they belong (the rewritten output parameters' lvalues) and discards the
+// rest, leaving a single Go expression of type eType.
+//
+// This tree has no assignment/declaration transpiler yet to call this with
+// the real width of a C assignment's left-hand side; every call site
+// currently goes through transpileCallExpr's numTargets=1, but the arity
+// selection itself - the part of the request this enables - is implemented
+// here and ready for that caller once it exists.
+func transpileCallExprForTargets(n *ast.CallExpr, p *program.Program, numTargets int) (*goast.CallExpr, string, error) {
+	e, eType, setsErrno, outputTargets, err := transpileCallExprSetsErrno(n, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	valueCount := 1 + len(outputTargets)
+	if setsErrno {
+		valueCount++
+	}
+
+	if valueCount <= numTargets {
+		return e, eType, nil
+	}
+
+	return wrapSingleValue(p, e, eType, setsErrno, outputTargets), eType, nil
+}
+
+// transpileCallExprSetsErrno is identical to transpileCallExpr except it
+// returns the real call expression - which may evaluate to more than one
+// Go value - instead of the single-valued wrapped form, along with whether
+// the call's substitution returns an additional error value derived from
+// "errno", and the lvalue expressions (in the same order as
+// FunctionDefinition.OutputParamIndices) that the call's former pointer
+// arguments addressed, for any output parameters that were rewritten to
+// return values. A nil entry means the argument wasn't a simple "&lvalue"
+// and the rewrite could not be resolved automatically.
+func transpileCallExprSetsErrno(n *ast.CallExpr, p *program.Program) (*goast.CallExpr, string, bool, []goast.Expr, error) {
+	// The first child is the callee. It is almost always wrapped in an
+	// ImplicitCastExpr (a function-to-pointer decay), which we unwrap before
+	// looking at what is actually being called.
+	callee := n.Children[0]
+	if implicitCast, ok := callee.(*ast.ImplicitCastExpr); ok {
+		callee = implicitCast.Children[0]
+	}
+
+	var functionName string
+	switch c := callee.(type) {
+	case *ast.DeclRefExpr:
+		// The common case: calling a function by name, like "foo()".
+		functionName = c.Name
+
+	default:
+		// Anything else is an indirect call - the callee is an expression
+		// that evaluates to a function, such as a function pointer, a
+		// function-typed parameter ("(*fn)(a, b)"), or a method-style call
+		// through a struct field ("obj.fn()"). There is no FunctionDefinition
+		// to validate against, but if the callee resolves to a name that
+		// getFieldList registered via types.RegisterFunctionPointerType, its
+		// real return and argument types are used; otherwise we fall back to
+		// passing arguments through unmodified and assuming a return type of
+		// "int".
+		calleeExpr, _, err := transpileToExpr(callee, p)
+		if err != nil {
+			return nil, "", false, nil, err
+		}
+
+		var ft *types.FunctionType
+		if name, ok := indirectCalleeName(callee); ok {
+			ft = types.LookupFunctionPointerType(name)
+		}
+
+		returnType := "int"
+		if ft != nil {
+			returnType = ft.ReturnType
+		}
+
+		args := []goast.Expr{}
+		for i, arg := range n.Children[1:] {
+			e, eType, err := transpileToExpr(arg, p)
+			if err != nil {
+				return nil, "unknown2", false, nil, err
+			}
+
+			if ft != nil && i < len(ft.ParameterTypes) {
+				e = types.CastExpr(p, e, eType, ft.ParameterTypes[i])
+			}
+
+			args = append(args, e)
+		}
+
+		indirectCall := &goast.CallExpr{
+			Fun:  calleeExpr,
+			Args: args,
+		}
+
+		return indirectCall, returnType, false, nil, nil
+	}
 
 	// Get the function definition from it's name. The case where it is not
 	// defined is handled below (we haven't seen the prototype yet).
@@ -35,7 +153,7 @@ func transpileCallExpr(n *ast.CallExpr, p *program.Program) (*goast.CallExpr, st
 
 	if functionDef == nil {
 		errorMessage := fmt.Sprintf("unknown function: %s", functionName)
-		return nil, "", errors.New(errorMessage)
+		return nil, "", false, nil, errors.New(errorMessage)
 	}
 
 	if functionDef.Substitution != "" {
@@ -47,12 +165,36 @@ func transpileCallExpr(n *ast.CallExpr, p *program.Program) (*goast.CallExpr, st
 		functionName = parts2[len(parts2)-1]
 	}
 
+	isOutputParam := make(map[int]bool, len(functionDef.OutputParamIndices))
+	for _, idx := range functionDef.OutputParamIndices {
+		isOutputParam[idx] = true
+	}
+
 	args := []goast.Expr{}
+	outputTargets := make([]goast.Expr, len(functionDef.OutputParamIndices))
 	i := 0
 	for _, arg := range n.Children[1:] {
+		if isOutputParam[i] {
+			// This argument was a pointer output parameter that the callee
+			// now returns as a value instead. Resolve the lvalue it
+			// addressed (the common "&x" case) so the caller can assign the
+			// returned value back into it; the argument itself is no longer
+			// passed.
+			if target, ok := addressedLvalue(arg, p); ok {
+				for j, idx := range functionDef.OutputParamIndices {
+					if idx == i {
+						outputTargets[j] = target
+					}
+				}
+			}
+
+			i++
+			continue
+		}
+
 		e, eType, err := transpileToExpr(arg, p)
 		if err != nil {
-			return nil, "unknown2", err
+			return nil, "unknown2", false, nil, err
 		}
 
 		if i > len(functionDef.ArgumentTypes)-1 {
@@ -66,10 +208,162 @@ func transpileCallExpr(n *ast.CallExpr, p *program.Program) (*goast.CallExpr, st
 		i++
 	}
 
-	return &goast.CallExpr{
-		Fun:  goast.NewIdent(functionName),
+	callExpr := &goast.CallExpr{
+		Fun:  calleeExprFor(functionName, mintPosition(p, n.Position)),
 		Args: args,
-	}, functionDef.ReturnType, nil
+	}
+
+	return callExpr, functionDef.ReturnType, functionDef.SetsErrno, outputTargets, nil
+}
+
+// calleeExprFor builds the Go AST expression used to call a function named
+// name, positioned at pos. A substitution name such as "noarch.Strtol" is
+// package-qualified, so it is built as a real *goast.SelectorExpr
+// (X: noarch, Sel: Strtol) rather than a single identifier literally named
+// "noarch.Strtol" - which would neither resolve under go/types nor count as
+// a use of the "noarch" import.
+func calleeExprFor(name string, pos token.Pos) goast.Expr {
+	if i := strings.LastIndex(name, "."); i != -1 {
+		pkg := goast.NewIdent(name[:i])
+		pkg.NamePos = pos
+
+		return &goast.SelectorExpr{
+			X:   pkg,
+			Sel: goast.NewIdent(name[i+1:]),
+		}
+	}
+
+	ident := goast.NewIdent(name)
+	ident.NamePos = pos
+
+	return ident
+}
+
+// indirectCalleeName unwraps the parens/dereference/casts around an indirect
+// call's callee - such as the "fn" in "(*fn)(a, b)" - down to the name it
+// was declared with, if it was a plain variable or parameter reference. ok
+// is false for any callee that isn't ultimately a simple name (for example,
+// a function returning a function pointer), since there is no registered
+// types.FunctionType to look up for those.
+func indirectCalleeName(n ast.Node) (string, bool) {
+	switch c := n.(type) {
+	case *ast.DeclRefExpr:
+		return c.Name, true
+
+	case *ast.MemberExpr:
+		// A method-style call through a struct field, like "obj.fn()" - the
+		// field name is the only handle back to its declared type, the same
+		// way a plain variable's name is for the DeclRefExpr case above.
+		return c.Name, true
+
+	case *ast.UnaryOperator:
+		if c.Operator == "*" && len(c.Children) == 1 {
+			return indirectCalleeName(c.Children[0])
+		}
+
+	case *ast.ParenExpr:
+		if len(c.Children) == 1 {
+			return indirectCalleeName(c.Children[0])
+		}
+
+	case *ast.ImplicitCastExpr:
+		if len(c.Children) == 1 {
+			return indirectCalleeName(c.Children[0])
+		}
+	}
+
+	return "", false
+}
+
+// addressedLvalue reports the lvalue expression addressed by a "&expr"
+// argument, so that a call site can assign a rewritten output parameter's
+// return value back into it. ok is false if arg isn't a simple address-of
+// expression, in which case the rewrite can't be resolved automatically.
+func addressedLvalue(arg ast.Node, p *program.Program) (goast.Expr, bool) {
+	n := arg
+	if implicitCast, ok := n.(*ast.ImplicitCastExpr); ok {
+		n = implicitCast.Children[0]
+	}
+
+	addrOf, ok := n.(*ast.UnaryOperator)
+	if !ok || addrOf.Operator != "&" || len(addrOf.Children) != 1 {
+		return nil, false
+	}
+
+	e, _, err := transpileToExpr(addrOf.Children[0], p)
+	if err != nil {
+		return nil, false
+	}
+
+	return e, true
+}
+
+// wrapSingleValue wraps call - whose Go substitution actually evaluates to
+// 1 + len(outputTargets) + (1 if setsErrno) values - in an immediately
+// invoked function literal that evaluates to a single value of type eType,
+// so it can be used anywhere a plain call expression is expected. Any
+// output parameter value is assigned back into its corresponding
+// outputTargets lvalue (a nil entry, meaning the lvalue couldn't be
+// resolved, is silently dropped, consistent with addressedLvalue); any
+// errno-derived error is discarded, since the caller only has room for the
+// single eType value and the underlying C code only ever checked the plain
+// return value here too.
+func wrapSingleValue(p *program.Program, call *goast.CallExpr, eType string, setsErrno bool, outputTargets []goast.Expr) *goast.CallExpr {
+	resultCount := 1 + len(outputTargets)
+	if setsErrno {
+		resultCount++
+	}
+
+	lhs := make([]goast.Expr, resultCount)
+	for i := range lhs {
+		lhs[i] = goast.NewIdent(fmt.Sprintf("r%d", i))
+	}
+
+	body := []goast.Stmt{
+		&goast.AssignStmt{
+			Lhs: lhs,
+			Tok: token.DEFINE,
+			Rhs: []goast.Expr{call},
+		},
+	}
+
+	for i, target := range outputTargets {
+		if target == nil {
+			continue
+		}
+
+		body = append(body, &goast.AssignStmt{
+			Lhs: []goast.Expr{target},
+			Tok: token.ASSIGN,
+			Rhs: []goast.Expr{lhs[1+i]},
+		})
+	}
+
+	if setsErrno {
+		body = append(body, &goast.AssignStmt{
+			Lhs: []goast.Expr{goast.NewIdent("_")},
+			Tok: token.ASSIGN,
+			Rhs: []goast.Expr{lhs[resultCount-1]},
+		})
+	}
+
+	body = append(body, &goast.ReturnStmt{
+		Results: []goast.Expr{lhs[0]},
+	})
+
+	return &goast.CallExpr{
+		Fun: &goast.FuncLit{
+			Type: &goast.FuncType{
+				Params: &goast.FieldList{},
+				Results: &goast.FieldList{
+					List: []*goast.Field{
+						{Type: goast.NewIdent(types.ResolveType(p, eType))},
+					},
+				},
+			},
+			Body: &goast.BlockStmt{List: body},
+		},
+	}
 }
 
 // transpileFunctionDecl transpiles the function prototype.
@@ -115,15 +409,11 @@ func transpileFunctionDecl(n *ast.FunctionDecl, p *program.Program) error {
 	// It's possible that the last node is the CompoundStmt (after all the
 	// parameter declarations) - but I don't know this for certain so we will
 	// look at all the children for now.
+	var bodyNode *ast.CompoundStmt
 	hasBody := false
 	for _, c := range n.Children {
 		if b, ok := c.(*ast.CompoundStmt); ok {
-			var err error
-			body, err = transpileToBlockStmt(b, p)
-			if err != nil {
-				return err
-			}
-
+			bodyNode = b
 			hasBody = true
 			break
 		}
@@ -145,16 +435,70 @@ func transpileFunctionDecl(n *ast.FunctionDecl, p *program.Program) error {
 	}
 
 	if hasBody {
-		fieldList, err := getFieldList(n, p)
+		// Pointer parameters that are only ever written to (never read or
+		// reassigned) are rewritten as additional return values, the way
+		// "int parse(const char *s, int *out)" becomes
+		// "func parse(s string) (int, int)" in idiomatic Go. This must run
+		// before the body below is transpiled: detectOutputParams also
+		// rewrites the qualifying "*p = expr" writes in n's C AST to
+		// "p = expr" in place, and transpileToBlockStmt needs to see that
+		// rewritten AST to emit a plain assignment rather than a
+		// dereference of a parameter that's about to stop being a pointer.
+		outputParams := detectOutputParams(n)
+		if len(outputParams) > 0 {
+			indices := make([]int, len(outputParams))
+			names := make([]string, len(outputParams))
+			for i, op := range outputParams {
+				indices[i] = op.Index
+				names[i] = op.Name
+			}
+
+			updated := *f
+			updated.OutputParamIndices = indices
+			updated.OutputParamNames = names
+			program.AddFunctionDefinition(updated)
+			f = &updated
+		}
+
+		var err error
+		body, err = transpileToBlockStmt(bodyNode, p)
 		if err != nil {
 			return err
 		}
 
+		fieldList, err := getFieldList(n, p, outputParams)
+		if err != nil {
+			return err
+		}
+
+		// Go forbids mixing named and unnamed results in the same signature,
+		// so once any output param forces its result to be named (below),
+		// the main result needs a name too - "r0". Nothing checks that no C
+		// parameter is also named "r0". It's never referred to by name:
+		// transpileReturnStmt always returns explicit expressions, never a
+		// naked "return".
+		mainResultName := []*goast.Ident(nil)
+		if len(outputParams) > 0 {
+			mainResultName = []*goast.Ident{goast.NewIdent("r0")}
+		}
+
 		returnTypes := []*goast.Field{
 			&goast.Field{
-				Type: goast.NewIdent(types.ResolveType(p, f.ReturnType)),
+				Names: mainResultName,
+				Type:  goast.NewIdent(types.ResolveType(p, f.ReturnType)),
 			},
 		}
+		for _, op := range outputParams {
+			// Named, not just typed: the body (rewritten by
+			// detectOutputParams to assign through the identifier directly
+			// instead of a pointer) and transpileReturnStmt both refer to
+			// this parameter by name, so it has to be in scope as a named
+			// result rather than a bare return type.
+			returnTypes = append(returnTypes, &goast.Field{
+				Names: []*goast.Ident{goast.NewIdent(op.Name)},
+				Type:  goast.NewIdent(types.ResolveType(p, op.PointeeType)),
+			})
+		}
 
 		// main() function does not have a return type.
 		if p.FunctionName == "main" {
@@ -173,26 +517,110 @@ func transpileFunctionDecl(n *ast.FunctionDecl, p *program.Program) error {
 			},
 			Body: body,
 		})
+
+		// Type-check everything transpiled into p.File so far. Since p.File
+		// accumulates one FuncDecl per call to transpileFunctionDecl, the
+		// translation unit's last function triggers a check of the whole
+		// file; any error is reported against the original C source position
+		// recovered via cPositionForPos instead of the generated Go.
+		if errs := Verify(p); len(errs) > 0 {
+			return errs[0]
+		}
 	}
 
 	return nil
 }
 
+// fieldTypeFor returns the Go AST type expression for a parameter named name
+// with C type cType. A function pointer type, such as
+// "int (*)(int, int)", is registered under name via
+// types.RegisterFunctionPointerType and resolved to a real "func(...) ..."
+// type, rather than falling through to types.ResolveType (which has no
+// function-pointer syntax of its own and would otherwise drop the
+// parameter's real shape); indirect calls through name can later look this
+// registration back up via types.LookupFunctionPointerType.
+func fieldTypeFor(p *program.Program, name, cType string) goast.Expr {
+	ft, ok := types.RegisterFunctionPointerType(name, cType)
+	if !ok {
+		return goast.NewIdent(types.ResolveType(p, cType))
+	}
+
+	return funcTypeFor(p, ft)
+}
+
+// funcTypeFor builds the Go AST function type for a C FunctionType.
+func funcTypeFor(p *program.Program, ft *types.FunctionType) *goast.FuncType {
+	params := []*goast.Field{}
+	for _, paramType := range ft.ParameterTypes {
+		params = append(params, &goast.Field{
+			Type: goast.NewIdent(types.ResolveType(p, paramType)),
+		})
+	}
+	if ft.IsVariadic {
+		params = append(params, &goast.Field{
+			Type: &goast.Ellipsis{Elt: goast.NewIdent("interface{}")},
+		})
+	}
+
+	return &goast.FuncType{
+		Params: &goast.FieldList{List: params},
+		Results: &goast.FieldList{
+			List: []*goast.Field{
+				{Type: goast.NewIdent(types.ResolveType(p, ft.ReturnType))},
+			},
+		},
+	}
+}
+
 // getFieldList returns the paramaters of a C function as a Go AST FieldList.
-func getFieldList(f *ast.FunctionDecl, p *program.Program) (*goast.FieldList, error) {
+//
+// If the function prototype is variadic (it ends in "...") a trailing
+// "...interface{}" field is appended, since the real argument types are not
+// known until the call site. Parameters identified by outputParams are
+// dropped entirely - they are emitted as additional return values instead,
+// see detectOutputParams.
+func getFieldList(f *ast.FunctionDecl, p *program.Program, outputParams []outputParam) (*goast.FieldList, error) {
 	// The main() function does not have arguments or a return value.
 	if f.Name == "main" {
 		return &goast.FieldList{}, nil
 	}
 
+	isOutputParam := make(map[int]bool, len(outputParams))
+	for _, op := range outputParams {
+		isOutputParam[op.Index] = true
+	}
+
 	r := []*goast.Field{}
+	index := -1
 	for _, n := range f.Children {
-		if v, ok := n.(*ast.ParmVarDecl); ok {
-			r = append(r, &goast.Field{
-				Names: []*goast.Ident{goast.NewIdent(v.Name)},
-				Type:  goast.NewIdent(types.ResolveType(p, v.Type)),
-			})
+		v, ok := n.(*ast.ParmVarDecl)
+		if !ok {
+			continue
 		}
+		index++
+
+		if isOutputParam[index] {
+			continue
+		}
+
+		name := goast.NewIdent(v.Name)
+		name.NamePos = mintPosition(p, v.Position)
+
+		field := &goast.Field{
+			Names: []*goast.Ident{name},
+			Type:  fieldTypeFor(p, v.Name, v.Type),
+		}
+
+		r = append(r, field)
+	}
+
+	if def := program.GetFunctionDefinition(f.Name); def != nil && def.IsVariadic {
+		r = append(r, &goast.Field{
+			Names: []*goast.Ident{goast.NewIdent("args")},
+			Type: &goast.Ellipsis{
+				Elt: goast.NewIdent("interface{}"),
+			},
+		})
 	}
 
 	return &goast.FieldList{
@@ -210,6 +638,15 @@ func transpileReturnStmt(n *ast.ReturnStmt, p *program.Program) (goast.Stmt, err
 
 	results := []goast.Expr{types.CastExpr(p, e, eType, f.ReturnType)}
 
+	// Parameters rewritten by detectOutputParams are no longer pointers; it
+	// also rewrote their "*p = expr" body writes to plain "p = expr", so the
+	// current value of each is simply its identifier.
+	for i, paramName := range f.OutputParamNames {
+		pointeeType, _ := nonConstPointeeType(f.ArgumentTypes[f.OutputParamIndices[i]])
+		results = append(results,
+			types.CastExpr(p, goast.NewIdent(paramName), pointeeType, pointeeType))
+	}
+
 	// main() function is not allowed to return a result. Use os.Exit if non-zero
 	if p.FunctionName == "main" {
 		litExpr, isLiteral := e.(*goast.BasicLit)
@@ -217,7 +654,7 @@ func transpileReturnStmt(n *ast.ReturnStmt, p *program.Program) (goast.Stmt, err
 			p.AddImport("os")
 			return &goast.ExprStmt{
 				X: &goast.CallExpr{
-					Fun:  goast.NewIdent("os.Exit"),
+					Fun:  calleeExprFor("os.Exit", token.NoPos),
 					Args: results,
 				},
 			}, nil
@@ -225,9 +662,12 @@ func transpileReturnStmt(n *ast.ReturnStmt, p *program.Program) (goast.Stmt, err
 		results = []goast.Expr{}
 	}
 
-	return &goast.ReturnStmt{
+	returnStmt := &goast.ReturnStmt{
+		Return:  mintPosition(p, n.Position),
 		Results: results,
-	}, nil
+	}
+
+	return returnStmt, nil
 }
 
 func getFunctionReturnType(f string) string {
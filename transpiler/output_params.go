@@ -0,0 +1,209 @@
+package transpiler
+
+import (
+	"strings"
+
+	"github.com/elliotchance/c2go/ast"
+)
+
+// outputParam identifies a C pointer parameter that is only ever the target
+// of a "*p = expr" assignment inside a function body - never read, never
+// reassigned to point somewhere else - and so can be rewritten as an
+// additional Go return value instead, the way idiomatic Go functions return
+// "extra" values rather than writing through a pointer argument.
+type outputParam struct {
+	// Index is the position of the parameter in the function's full
+	// parameter list.
+	Index int
+
+	// Name is the C parameter name.
+	Name string
+
+	// PointeeType is the C type being pointed to, e.g. "int" for "int*".
+	PointeeType string
+}
+
+// detectOutputParams scans f's body (if it has one) for pointer parameters
+// that qualify as output parameters. It is a conservative, syntactic check:
+// anything we can't positively identify as a qualifying write disqualifies
+// the parameter, so at worst we miss a rewrite opportunity rather than
+// rewriting a parameter that is also used for input.
+func detectOutputParams(f *ast.FunctionDecl) []outputParam {
+	var body *ast.CompoundStmt
+	for _, c := range f.Children {
+		if b, ok := c.(*ast.CompoundStmt); ok {
+			body = b
+			break
+		}
+	}
+
+	if body == nil {
+		return nil
+	}
+
+	var candidates []outputParam
+	index := -1
+	for _, c := range f.Children {
+		v, ok := c.(*ast.ParmVarDecl)
+		if !ok {
+			continue
+		}
+		index++
+
+		pointeeType, isPointer := nonConstPointeeType(v.Type)
+		if !isPointer {
+			continue
+		}
+
+		if isWriteOnlyOutputParam(body, v.Name) {
+			candidates = append(candidates, outputParam{
+				Index:       index,
+				Name:        v.Name,
+				PointeeType: pointeeType,
+			})
+		}
+	}
+
+	return candidates
+}
+
+// nonConstPointeeType returns the pointee type of a non-const single-level
+// pointer C type, such as "int" for "int *". ok is false for anything else
+// (not a pointer, a pointer-to-const, a multi-level pointer, etc.) since
+// those are not candidates for this rewrite.
+func nonConstPointeeType(cType string) (pointeeType string, ok bool) {
+	t := strings.TrimSpace(cType)
+
+	if !strings.HasSuffix(t, "*") || strings.Count(t, "*") != 1 {
+		return "", false
+	}
+
+	if strings.Contains(t, "const") {
+		return "", false
+	}
+
+	return strings.TrimSpace(strings.TrimSuffix(t, "*")), true
+}
+
+// isWriteOnlyOutputParam reports whether name, a pointer parameter, is only
+// ever used inside body as the target of "*name = expr", and never read or
+// reassigned to point elsewhere. If it qualifies, every such write is also
+// rewritten in place from "*name = expr" to "name = expr" - splicing out the
+// "*" dereference - since the parameter is being turned into a named return
+// value rather than a pointer, and the assignment needs to target the
+// identifier directly.
+func isWriteOnlyOutputParam(body *ast.CompoundStmt, name string) bool {
+	qualifies := true
+
+	type write struct {
+		assign *ast.BinaryOperator
+		deref  *ast.UnaryOperator
+	}
+	var writes []write
+
+	var walk func(n ast.Node, parent ast.Node, grandparent ast.Node)
+	walk = func(n ast.Node, parent ast.Node, grandparent ast.Node) {
+		if n == nil || !qualifies {
+			return
+		}
+
+		if ref, ok := n.(*ast.DeclRefExpr); ok && ref.Name == name {
+			deref, parentIsDeref := parent.(*ast.UnaryOperator)
+			assign, grandparentIsAssign := grandparent.(*ast.BinaryOperator)
+
+			qualifyingWrite := parentIsDeref && deref.Operator == "*" &&
+				grandparentIsAssign && assign.Operator == "=" &&
+				len(assign.Children) > 0 && assign.Children[0] == parent
+
+			if !qualifyingWrite {
+				qualifies = false
+				return
+			}
+
+			writes = append(writes, write{assign: assign, deref: deref})
+			return
+		}
+
+		children, recognized := childrenOf(n)
+		if !recognized {
+			// An unrecognized node kind might contain a read of name
+			// somewhere inside it and we have no way to tell without
+			// walking its children, which childrenOf doesn't know how to
+			// list. Disqualifying here is what keeps the "at worst we miss
+			// a rewrite opportunity" guarantee true instead of silently
+			// treating an unwalked subtree as containing no references.
+			qualifies = false
+			return
+		}
+
+		for _, child := range children {
+			walk(child, n, parent)
+		}
+	}
+
+	walk(body, nil, nil)
+
+	if !qualifies || len(writes) == 0 {
+		return false
+	}
+
+	for _, w := range writes {
+		w.assign.Children[0] = w.deref.Children[0]
+	}
+
+	return true
+}
+
+// childrenOf returns the children of n and whether n is a node kind this
+// analysis knows how to fully walk. recognized is false for any node kind
+// not listed here, so the caller can disqualify rather than silently
+// treating an unwalked subtree as free of references - see the comment at
+// its only call site in isWriteOnlyOutputParam.
+func childrenOf(n ast.Node) (children []ast.Node, recognized bool) {
+	switch v := n.(type) {
+	case *ast.CompoundStmt:
+		return v.Children, true
+	case *ast.BinaryOperator:
+		return v.Children, true
+	case *ast.UnaryOperator:
+		return v.Children, true
+	case *ast.CallExpr:
+		return v.Children, true
+	case *ast.ImplicitCastExpr:
+		return v.Children, true
+	case *ast.ReturnStmt:
+		return v.Children, true
+	case *ast.IfStmt:
+		return v.Children, true
+	case *ast.ForStmt:
+		return v.Children, true
+	case *ast.WhileStmt:
+		return v.Children, true
+	case *ast.ParenExpr:
+		return v.Children, true
+	case *ast.DeclStmt:
+		return v.Children, true
+	case *ast.ArraySubscriptExpr:
+		return v.Children, true
+	case *ast.ConditionalOperator:
+		return v.Children, true
+	case *ast.CStyleCastExpr:
+		return v.Children, true
+	case *ast.SwitchStmt:
+		return v.Children, true
+	case *ast.MemberExpr:
+		return v.Children, true
+	case *ast.DeclRefExpr:
+		// Handled directly by the caller (it's the node carrying Name), but
+		// it has no children of its own either way.
+		return nil, true
+	case *ast.VarDecl:
+		return v.Children, true
+	case *ast.IntegerLiteral, *ast.FloatingLiteral, *ast.StringLiteral,
+		*ast.CharacterLiteral, *ast.BreakStmt, *ast.ContinueStmt:
+		// Leaves: no children, nothing to disqualify on.
+		return nil, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,120 @@
+package transpiler
+
+import (
+	"testing"
+
+	"github.com/elliotchance/c2go/ast"
+)
+
+// strtolLikeFunctionDecl builds the AST for a function shaped like the C
+// library's strtol (OutputParamIndices + SetsErrno is exactly the
+// combination this rewrite exists for): a pointer "output" parameter next to
+// two ordinary input parameters, whose body writes through the pointer
+// exactly once before returning. detectOutputParams and
+// transpileFunctionDecl can't see SetsErrno at all - that flag lives on the
+// FunctionDefinition the substitution table already carries for "strtol"
+// itself - so the only thing this constructs is the body shape that, when
+// combined with a SetsErrno FunctionDefinition (as real strtol's is),
+// exercises both rewrites on the same function.
+func strtolLikeFunctionDecl(outWrite ast.Node) *ast.FunctionDecl {
+	return &ast.FunctionDecl{
+		Name: "my_strtol",
+		Children: []ast.Node{
+			&ast.ParmVarDecl{Name: "nptr", Type: "const char *"},
+			&ast.ParmVarDecl{Name: "base", Type: "int"},
+			&ast.ParmVarDecl{Name: "out", Type: "long *"},
+			&ast.CompoundStmt{
+				Children: []ast.Node{
+					outWrite,
+					&ast.ReturnStmt{
+						Children: []ast.Node{&ast.IntegerLiteral{}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func outParamWrite(name string) ast.Node {
+	deref := &ast.UnaryOperator{
+		Operator: "*",
+		Children: []ast.Node{&ast.DeclRefExpr{Name: name}},
+	}
+
+	return &ast.BinaryOperator{
+		Operator: "=",
+		Children: []ast.Node{deref, &ast.IntegerLiteral{}},
+	}
+}
+
+func TestDetectOutputParams_StrtolStyleWriteOnly(t *testing.T) {
+	got := detectOutputParams(strtolLikeFunctionDecl(outParamWrite("out")))
+
+	if len(got) != 1 {
+		t.Fatalf("detectOutputParams() = %#v, want exactly one output param", got)
+	}
+
+	want := outputParam{Index: 2, Name: "out", PointeeType: "long"}
+	if got[0] != want {
+		t.Errorf("detectOutputParams()[0] = %#v, want %#v", got[0], want)
+	}
+}
+
+func TestDetectOutputParams_RewritesDerefInPlace(t *testing.T) {
+	write := outParamWrite("out")
+	detectOutputParams(strtolLikeFunctionDecl(write))
+
+	assign := write.(*ast.BinaryOperator)
+	ref, ok := assign.Children[0].(*ast.DeclRefExpr)
+	if !ok || ref.Name != "out" {
+		t.Errorf("assign.Children[0] = %#v, want the bare DeclRefExpr for \"out\" "+
+			"(the \"*\" dereference should have been spliced out)", assign.Children[0])
+	}
+}
+
+// TestDetectOutputParams_ReadDisqualifies covers the childrenOf gap this
+// rewrite used to have: a read of the output parameter reachable only
+// through a node kind childrenOf didn't walk (here, a local variable's
+// initializer inside a DeclStmt) used to be invisible to
+// isWriteOnlyOutputParam, so "out" was wrongly rewritten to a return value
+// even though "z" still needed to read it as a pointer.
+func TestDetectOutputParams_ReadDisqualifies(t *testing.T) {
+	f := strtolLikeFunctionDecl(outParamWrite("out"))
+	body := f.Children[3].(*ast.CompoundStmt)
+	body.Children = append([]ast.Node{
+		&ast.DeclStmt{
+			Children: []ast.Node{
+				&ast.VarDecl{
+					Name:     "z",
+					Children: []ast.Node{&ast.DeclRefExpr{Name: "out"}},
+				},
+			},
+		},
+	}, body.Children...)
+
+	if got := detectOutputParams(f); len(got) != 0 {
+		t.Errorf("detectOutputParams() = %#v, want none: \"out\" is read inside the DeclStmt", got)
+	}
+}
+
+func TestNonConstPointeeType(t *testing.T) {
+	tests := []struct {
+		cType           string
+		wantPointeeType string
+		wantOK          bool
+	}{
+		{"int *", "int", true},
+		{"char**", "", false},
+		{"const char *", "", false},
+		{"int **", "", false},
+		{"int", "", false},
+	}
+
+	for _, test := range tests {
+		pointeeType, ok := nonConstPointeeType(test.cType)
+		if ok != test.wantOK || pointeeType != test.wantPointeeType {
+			t.Errorf("nonConstPointeeType(%q) = (%q, %v), want (%q, %v)",
+				test.cType, pointeeType, ok, test.wantPointeeType, test.wantOK)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package transpiler
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/elliotchance/c2go/program"
+)
+
+// verifyState holds the position-tracking state for one translation unit
+// (one *program.Program). Keeping it per-program - rather than a single
+// process-global map - means translating several C files in the same
+// process (for example, a whole directory) can't leak one file's recorded
+// positions into another's error messages.
+type verifyState struct {
+	fset *token.FileSet
+	file *token.File
+
+	// nextOffset is the next not-yet-used offset into file. Every call to
+	// mintPosition hands out a unique token.Pos by advancing this, so two
+	// different synthesized nodes can never collide on the same position -
+	// unlike looking a node up by comparing Pos() values, which is only
+	// unique if every node was actually given one.
+	nextOffset int
+
+	// cPositions maps a minted token.Pos back to the C source position it
+	// stands in for.
+	cPositions map[token.Pos]string
+}
+
+var verifyStates = map[*program.Program]*verifyState{}
+
+func stateFor(p *program.Program) *verifyState {
+	if s, ok := verifyStates[p]; ok {
+		return s
+	}
+
+	fset := token.NewFileSet()
+	s := &verifyState{
+		fset: fset,
+		// The file is never parsed from real source, so its size only needs
+		// to be large enough to hand out one offset per recorded node.
+		file:       fset.AddFile("<transpiled>", -1, 1<<30),
+		nextOffset: 1,
+		cPositions: map[token.Pos]string{},
+	}
+	verifyStates[p] = s
+
+	return s
+}
+
+// mintPosition allocates a unique token.Pos standing in for cPosition, valid
+// within p's FileSet. The returned Pos should be assigned directly onto the
+// Go AST node it was minted for (e.g. an *goast.Ident's NamePos, or a
+// *goast.ReturnStmt's Return field) so that go/types reports errors against
+// it, and cPositionForPos(p, ...) can later recover the original C location.
+func mintPosition(p *program.Program, cPosition string) token.Pos {
+	if cPosition == "" {
+		return token.NoPos
+	}
+
+	s := stateFor(p)
+	pos := s.file.Pos(s.nextOffset)
+	s.nextOffset++
+	s.cPositions[pos] = cPosition
+
+	return pos
+}
+
+// cPositionForPos looks up the C source position recorded for a token.Pos
+// minted by mintPosition, if any.
+func cPositionForPos(p *program.Program, pos token.Pos) (string, bool) {
+	cPosition, ok := stateFor(p).cPositions[pos]
+
+	return cPosition, ok
+}
+
+// Verify type-checks the Go file transpiled so far in p.File using go/types,
+// against a synthetic importer that knows about the packages this module
+// emits references to (noarch, darwin, linux, math, fmt, os, ...). It is
+// called automatically at the end of transpileFunctionDecl, once for each
+// function definition (with a body) that is emitted as Go; since p.File
+// accumulates every FuncDecl as it is transpiled, by the time the
+// translation unit's last function has been processed the whole file has
+// been checked.
+//
+// A type error whose position was recorded is reported as the original C
+// source position recovered via cPositionForPos followed by the go/types
+// message, so contributors see e.g.
+//
+//	line:18:7: cannot use x (variable of type float64) as int value in return statement
+//
+// instead of a go build error against the generated code.
+func Verify(p *program.Program) []error {
+	info := &types.Info{
+		Types: map[goast.Expr]types.TypeAndValue{},
+	}
+
+	var errs []error
+	conf := types.Config{
+		Importer: newShimImporter(p),
+		Error: func(err error) {
+			errs = append(errs, attachCPosition(p, err))
+		},
+	}
+
+	s := stateFor(p)
+
+	// The error is also returned directly by Check, but every error
+	// (including ones after the first) is already collected via conf.Error
+	// above, so it is intentionally not inspected here.
+	_, _ = conf.Check(p.File.Name.Name, s.fset, []*goast.File{p.File}, info)
+
+	return errs
+}
+
+// attachCPosition rewrites a types.Error so that its position is reported
+// in terms of the original C source, if we recorded one for the offending
+// position.
+func attachCPosition(p *program.Program, err error) error {
+	typeErr, ok := err.(types.Error)
+	if !ok {
+		return err
+	}
+
+	if cPosition, ok := cPositionForPos(p, typeErr.Pos); ok {
+		return fmt.Errorf("%s: %s", cPosition, typeErr.Msg)
+	}
+
+	return err
+}
+
+// newShimImporter returns a types.Importer that can resolve the standard
+// library packages this module emits calls to (fmt, os, math, ...) plus its
+// own noarch/darwin/linux packages.
+func newShimImporter(p *program.Program) types.Importer {
+	return &shimImporter{p: p, fallback: importer.Default()}
+}
+
+type shimImporter struct {
+	p        *program.Program
+	fallback types.Importer
+}
+
+func (s *shimImporter) Import(path string) (*types.Package, error) {
+	switch path {
+	case "github.com/elliotchance/c2go/noarch",
+		"github.com/elliotchance/c2go/darwin",
+		"github.com/elliotchance/c2go/linux":
+		// These packages are part of this module rather than somewhere
+		// go/importer can always find them (for example, when c2go itself
+		// is run as an installed binary outside of a GOPATH checkout, or
+		// when - as with darwin/linux in this tree - the package hasn't
+		// been written yet). Rather than resolve to an empty package (which
+		// would make every call into it "undefined", turning Verify into a
+		// false-positive generator for the overwhelmingly common case of a
+		// substituted libc call), populate it with a *types.Func per
+		// FunctionDefinition this module already knows points here -
+		// program.SubstitutionFunctions is the same data functions.go used
+		// to decide what to call, so the two can't drift apart.
+		name := path[strings.LastIndex(path, "/")+1:]
+		pkg := types.NewPackage(path, name)
+
+		for goName, def := range program.SubstitutionFunctions(name) {
+			pkg.Scope().Insert(types.NewFunc(token.NoPos, pkg, goName,
+				substitutionSignature(s.p, def)))
+		}
+		pkg.MarkComplete()
+
+		return pkg, nil
+
+	default:
+		return s.fallback.Import(path)
+	}
+}
+
+// substitutionSignature builds the go/types function signature that
+// corresponds to def's Go substitution, so the shim package Import
+// populates can be type-checked against like any other imported function.
+func substitutionSignature(p *program.Program, def program.FunctionDefinition) *types.Signature {
+	params := make([]*types.Var, len(def.ArgumentTypes))
+	for i, argType := range def.ArgumentTypes {
+		params[i] = types.NewVar(token.NoPos, nil, "", goTypeFor(types.ResolveType(p, argType)))
+	}
+
+	results := []*types.Var{
+		types.NewVar(token.NoPos, nil, "", goTypeFor(types.ResolveType(p, def.ReturnType))),
+	}
+	if def.SetsErrno {
+		results = append(results, types.NewVar(token.NoPos, nil, "", goTypeFor("error")))
+	}
+
+	return types.NewSignature(nil,
+		types.NewTuple(params...), types.NewTuple(results...), def.IsVariadic)
+}
+
+// goTypeFor resolves a Go type name (as produced by types.ResolveType) to
+// its go/types.Type. Anything this shim doesn't recognize - a c2go-specific
+// alias like "Double2", or a named type defined elsewhere in the
+// translation unit - is treated as interface{}, so the signature still
+// type-checks without asserting anything false about its shape.
+func goTypeFor(goTypeName string) types.Type {
+	if obj := types.Universe.Lookup(goTypeName); obj != nil {
+		if _, ok := obj.(*types.TypeName); ok {
+			return obj.Type()
+		}
+	}
+
+	return types.NewInterfaceType(nil, nil)
+}
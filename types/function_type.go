@@ -0,0 +1,84 @@
+package types
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FunctionType describes the C type of a function (as opposed to the type of
+// a value). It is used to resolve pointer-to-function locals - declared
+// through a ParmVarDecl or VarDecl whose type is a function pointer - to a
+// real Go "func(...) ..." type instead of the pointer being dropped.
+type FunctionType struct {
+	// ReturnType is the C return type, like "int".
+	ReturnType string
+
+	// ParameterTypes are the C argument types, in order.
+	ParameterTypes []string
+
+	// IsVariadic is true when the function accepts a trailing "...".
+	IsVariadic bool
+}
+
+// functionPointerTypeRegexp matches a C function pointer type, such as
+// "int (*)(int, int)", capturing the return type and the parameter list.
+var functionPointerTypeRegexp = regexp.MustCompile(`^(.+)\(\*\)\((.*)\)$`)
+
+// ParseFunctionPointerType parses a C function pointer type string, such as
+// "int (*)(int, int)" or "void (*)(void)", into its return and parameter
+// types. ok is false if cType is not a function pointer type.
+func ParseFunctionPointerType(cType string) (*FunctionType, bool) {
+	match := functionPointerTypeRegexp.FindStringSubmatch(strings.TrimSpace(cType))
+	if match == nil {
+		return nil, false
+	}
+
+	parameterTypes := strings.Split(match[2], ",")
+	for i := range parameterTypes {
+		parameterTypes[i] = strings.TrimSpace(parameterTypes[i])
+	}
+	if len(parameterTypes) == 1 && parameterTypes[0] == "" {
+		parameterTypes = []string{}
+	}
+
+	isVariadic := false
+	if len(parameterTypes) > 0 && parameterTypes[len(parameterTypes)-1] == "..." {
+		isVariadic = true
+		parameterTypes = parameterTypes[:len(parameterTypes)-1]
+	}
+
+	return &FunctionType{
+		ReturnType:     strings.TrimSpace(match[1]),
+		ParameterTypes: parameterTypes,
+		IsVariadic:     isVariadic,
+	}, true
+}
+
+// functionPointerTypesByName is a registry of known function pointer types,
+// keyed by the name of the variable or parameter they were declared with
+// (for example "compare" in "int (*compare)(int, int)"). This tree has no
+// scope-aware symbol table, so a name is the only handle an indirect call
+// site has back to the declaration that gave it a real type.
+var functionPointerTypesByName = map[string]*FunctionType{}
+
+// RegisterFunctionPointerType parses cType and, if it is a function pointer
+// type, registers it under name so that a later indirect call through name
+// can be resolved to its real return and argument types instead of falling
+// back to "int". ok reports whether cType was a function pointer type.
+func RegisterFunctionPointerType(name, cType string) (*FunctionType, bool) {
+	f, ok := ParseFunctionPointerType(cType)
+	if !ok {
+		return nil, false
+	}
+
+	functionPointerTypesByName[name] = f
+
+	return f, true
+}
+
+// LookupFunctionPointerType returns the FunctionType previously registered
+// for name via RegisterFunctionPointerType, or nil if name is not a known
+// function pointer.
+func LookupFunctionPointerType(name string) *FunctionType {
+	return functionPointerTypesByName[name]
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFunctionPointerType(t *testing.T) {
+	tests := []struct {
+		cType string
+		want  *FunctionType
+	}{
+		{
+			"int (*)(int, int)",
+			&FunctionType{ReturnType: "int", ParameterTypes: []string{"int", "int"}},
+		},
+		{
+			"void (*)(void)",
+			&FunctionType{ReturnType: "void", ParameterTypes: []string{"void"}},
+		},
+		{
+			"int (*)(const char *, ...)",
+			&FunctionType{
+				ReturnType:     "int",
+				ParameterTypes: []string{"const char *"},
+				IsVariadic:     true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		got, ok := ParseFunctionPointerType(test.cType)
+		if !ok {
+			t.Errorf("ParseFunctionPointerType(%q) returned ok=false", test.cType)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ParseFunctionPointerType(%q) = %#v, want %#v",
+				test.cType, got, test.want)
+		}
+	}
+
+	if _, ok := ParseFunctionPointerType("int"); ok {
+		t.Errorf("ParseFunctionPointerType(%q) returned ok=true, want false", "int")
+	}
+}